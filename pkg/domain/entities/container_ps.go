@@ -1,8 +1,14 @@
 package entities
 
 import (
+	"bytes"
+	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/containers/libpod/cmd/podman/shared"
 	"github.com/containers/libpod/libpod"
@@ -147,28 +153,351 @@ func (a PsSortedCreateTime) Less(i, j int) bool {
 	return a.SortListContainers[i].Created < a.SortListContainers[j].Created
 }
 
-func SortPsOutput(sortBy string, psOutput SortListContainers) (SortListContainers, error) {
+// psSortFunc returns the Less function associated with a single --sort
+// subkey, bound to psOutput so it can be composed with other subkeys.
+func psSortFunc(sortBy string, psOutput SortListContainers) (func(i, j int) bool, error) {
 	switch sortBy {
 	case "id":
-		sort.Sort(psSortedId{psOutput})
+		return psSortedId{psOutput}.Less, nil
 	case "image":
-		sort.Sort(psSortedImage{psOutput})
+		return psSortedImage{psOutput}.Less, nil
 	case "command":
-		sort.Sort(psSortedCommand{psOutput})
+		return psSortedCommand{psOutput}.Less, nil
 	case "runningfor":
-		sort.Sort(psSortedRunningFor{psOutput})
+		return psSortedRunningFor{psOutput}.Less, nil
 	case "status":
-		sort.Sort(psSortedStatus{psOutput})
+		return psSortedStatus{psOutput}.Less, nil
 	case "size":
-		sort.Sort(psSortedSize{psOutput})
+		return psSortedSize{psOutput}.Less, nil
 	case "names":
-		sort.Sort(psSortedNames{psOutput})
+		return psSortedNames{psOutput}.Less, nil
 	case "created":
-		sort.Sort(PsSortedCreateTime{psOutput})
+		return PsSortedCreateTime{psOutput}.Less, nil
 	case "pod":
-		sort.Sort(psSortedPod{psOutput})
+		return psSortedPod{psOutput}.Less, nil
 	default:
 		return nil, errors.Errorf("invalid option for --sort, options are: command, created, id, image, names, runningfor, size, or status")
 	}
+}
+
+// reverseLess flips a Less function so it sorts in descending order.
+func reverseLess(less func(i, j int) bool) func(i, j int) bool {
+	return func(i, j int) bool { return less(j, i) }
+}
+
+// SortPsOutput sorts psOutput by one or more comma-separated sort keys
+// (e.g. "pod,-created,names"). Each subkey may be prefixed with "-" to
+// sort that subkey in descending order. Subkeys are applied in order,
+// with later subkeys breaking ties left by earlier ones, using a stable
+// sort so equally-ranked containers keep their relative order.
+func SortPsOutput(sortBy string, psOutput SortListContainers) (SortListContainers, error) {
+	subKeys := strings.Split(sortBy, ",")
+	lessFuncs := make([]func(i, j int) bool, 0, len(subKeys))
+	for _, subKey := range subKeys {
+		subKey = strings.TrimSpace(subKey)
+		descending := strings.HasPrefix(subKey, "-")
+		if descending {
+			subKey = strings.TrimPrefix(subKey, "-")
+		}
+		lessFunc, err := psSortFunc(subKey, psOutput)
+		if err != nil {
+			return nil, err
+		}
+		if descending {
+			lessFunc = reverseLess(lessFunc)
+		}
+		lessFuncs = append(lessFuncs, lessFunc)
+	}
+
+	sort.SliceStable(psOutput, func(i, j int) bool {
+		for _, less := range lessFuncs {
+			switch {
+			case less(i, j):
+				return true
+			case less(j, i):
+				return false
+			}
+		}
+		return false
+	})
 	return psOutput, nil
 }
+
+// psFilterPredicate is evaluated against a single ListContainer; it
+// returns true when the container should be kept.
+type psFilterPredicate func(ListContainer) bool
+
+// findPsOutput looks up a container within psOutput by ID prefix or name,
+// as used by the since= and before= filters to resolve their reference
+// container.
+func findPsOutput(idOrName string, psOutput SortListContainers) (*ListContainer, bool) {
+	for i := range psOutput {
+		ctr := &psOutput[i]
+		if strings.HasPrefix(ctr.ID, idOrName) {
+			return ctr, true
+		}
+		for _, name := range ctr.Names {
+			if name == idOrName {
+				return ctr, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// psFilterFunc parses a single docker-compatible filter expression
+// (key=value, or key!=value for negatable filters) and returns the key
+// it applies to along with the predicate it represents.
+func psFilterFunc(filter string, psOutput SortListContainers) (string, psFilterPredicate, error) {
+	// The key/value separator is always the *first* "=" in the filter;
+	// anything after it (e.g. "!=" inside a label value) belongs to the
+	// value, not the key.
+	idx := strings.Index(filter, "=")
+	if idx == -1 {
+		return "", nil, errors.Errorf("invalid filter %q: expected key=value", filter)
+	}
+	negate := idx > 0 && filter[idx-1] == '!'
+	keyEnd := idx
+	if negate {
+		keyEnd--
+	}
+	key := filter[:keyEnd]
+	val := filter[idx+1:]
+
+	var predicate psFilterPredicate
+	switch key {
+	case "status":
+		predicate = func(c ListContainer) bool { return c.State == val }
+	case "label":
+		labelKey, labelVal := val, ""
+		hasVal := false
+		if i := strings.Index(val, "="); i != -1 {
+			labelKey, labelVal, hasVal = val[:i], val[i+1:], true
+		}
+		predicate = func(c ListContainer) bool {
+			v, ok := c.Labels[labelKey]
+			if !ok {
+				return false
+			}
+			if !hasVal {
+				return true
+			}
+			return v == labelVal
+		}
+	case "name":
+		if strings.HasPrefix(val, "/") && strings.HasSuffix(val, "/") && len(val) > 1 {
+			re, err := regexp.Compile(val[1 : len(val)-1])
+			if err != nil {
+				return "", nil, errors.Wrapf(err, "invalid regex for name filter %q", val)
+			}
+			predicate = func(c ListContainer) bool {
+				for _, name := range c.Names {
+					if re.MatchString(name) {
+						return true
+					}
+				}
+				return false
+			}
+		} else {
+			predicate = func(c ListContainer) bool {
+				for _, name := range c.Names {
+					if strings.Contains(name, val) {
+						return true
+					}
+				}
+				return false
+			}
+		}
+	case "id":
+		predicate = func(c ListContainer) bool { return strings.HasPrefix(c.ID, val) }
+	case "pod":
+		predicate = func(c ListContainer) bool { return c.Pod == val || c.PodName == val }
+	case "exited":
+		code, err := strconv.Atoi(val)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "invalid exited filter %q: expected an integer exit code", val)
+		}
+		predicate = func(c ListContainer) bool { return c.Exited && c.ExitCode == int32(code) }
+	case "since":
+		since, ok := findPsOutput(val, psOutput)
+		if !ok {
+			return "", nil, errors.Errorf("since filter %q does not match any container", val)
+		}
+		predicate = func(c ListContainer) bool { return c.Created > since.Created }
+	case "before":
+		before, ok := findPsOutput(val, psOutput)
+		if !ok {
+			return "", nil, errors.Errorf("before filter %q does not match any container", val)
+		}
+		predicate = func(c ListContainer) bool { return c.Created < before.Created }
+	case "ancestor":
+		predicate = func(c ListContainer) bool { return c.Image == val || strings.HasPrefix(c.Image, val+":") }
+	case "health":
+		// ListContainer carries no health-check status, so there is no
+		// honest way to evaluate this filter; reject it rather than
+		// matching against an unrelated field.
+		return "", nil, errors.Errorf("health filter is not supported: ListContainer does not track health-check status")
+	default:
+		return "", nil, errors.Errorf("invalid filter %q: unknown key %q", filter, key)
+	}
+
+	if negate {
+		inner := predicate
+		predicate = func(c ListContainer) bool { return !inner(c) }
+	}
+	return key, predicate, nil
+}
+
+// FilterPsOutput filters psOutput using docker-compatible filter
+// expressions (e.g. "status=running", "label=foo=bar", "name=/^web-/").
+// Filters sharing the same key are ORed together (e.g. "status=running"
+// plus "status=paused" keeps containers in either state), while distinct
+// keys are ANDed.
+func FilterPsOutput(filters []string, psOutput SortListContainers) (SortListContainers, error) {
+	var keyOrder []string
+	predicatesByKey := make(map[string][]psFilterPredicate)
+	for _, filter := range filters {
+		key, predicate, err := psFilterFunc(filter, psOutput)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := predicatesByKey[key]; !ok {
+			keyOrder = append(keyOrder, key)
+		}
+		predicatesByKey[key] = append(predicatesByKey[key], predicate)
+	}
+
+	filtered := make(SortListContainers, 0, len(psOutput))
+containers:
+	for _, ctr := range psOutput {
+		for _, key := range keyOrder {
+			matchesKey := false
+			for _, predicate := range predicatesByKey[key] {
+				if predicate(ctr) {
+					matchesKey = true
+					break
+				}
+			}
+			if !matchesKey {
+				continue containers
+			}
+		}
+		filtered = append(filtered, ctr)
+	}
+	return filtered, nil
+}
+
+// jsonPathField matches a bare JSONPath field reference such as
+// "{.Names}" or "{.Namespaces.MNT}", as opposed to a Go template action
+// like "{{.Names}}".
+var jsonPathField = regexp.MustCompile(`\{(\.[A-Za-z0-9_]+(?:\.[A-Za-z0-9_]+)*)\}`)
+
+// jsonPathLike matches anything that still looks like a single-brace
+// JSONPath expression once every jsonPathField match has been removed
+// from the format; anything left is unsupported syntax (e.g. an index
+// expression) rather than a field we silently pass through.
+var jsonPathLike = regexp.MustCompile(`\{\.[^{}]*\}`)
+
+// psFieldRef matches a field reference within a Go template or JSONPath
+// expression, e.g. the "StartedAt" in "{{humanDuration .StartedAt}}".
+var psFieldRef = regexp.MustCompile(`\.([A-Z][A-Za-z0-9_]*)`)
+
+// psTemplateFuncs are the extra functions available to ProjectPsOutput
+// format strings, on top of the usual text/template built-ins.
+var psTemplateFuncs = template.FuncMap{
+	"humanDuration": func(unixSeconds int64) string {
+		d := time.Since(time.Unix(unixSeconds, 0)).Round(time.Second)
+		return d.String() + " ago"
+	},
+}
+
+// PsFields returns the field names referenced by a ProjectPsOutput
+// format string, e.g. PsFields("{{.Names}}") returns []string{"Names"}.
+// Every segment of a nested path is returned, so "{.Namespaces.MNT}"
+// yields []string{"Namespaces", "MNT"}. Pair it with NeedsSize/NeedsNamespaces to inspect
+// whether a given format touches those fields before building psOutput.
+func PsFields(format string) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, match := range psFieldRef.FindAllStringSubmatch(format, -1) {
+		name := match[1]
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// NeedsSize reports whether fields (as returned by PsFields) references
+// the Size column, i.e. whether a caller needs to populate
+// ListContainer.Size (which requires walking the container's rootfs)
+// before building psOutput.
+func NeedsSize(fields []string) bool {
+	return containsField(fields, "Size")
+}
+
+// NeedsNamespaces reports whether fields (as returned by PsFields)
+// references Namespaces, i.e. whether a caller needs to populate
+// ListContainer.Namespaces before building psOutput.
+func NeedsNamespaces(fields []string) bool {
+	return containsField(fields, "Namespaces")
+}
+
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectPsOutput evaluates format - either a Go text/template
+// ("{{.Names}}", "{{humanDuration .StartedAt}}") or a bare JSONPath
+// expression ("{.Names}", "{.Namespaces.MNT}") - against each
+// ListContainer in psOutput and returns one row per container. Each row
+// holds the raw value of every top-level ListContainer field referenced
+// by format (see PsFields) under its field name, plus the rendered
+// template result under "Output" for computed columns. Nested segments
+// such as MNT in "{.Namespaces.MNT}" get no key of their own; their
+// value is only in "Output" and within the enclosing field's value.
+func ProjectPsOutput(format string, psOutput SortListContainers) ([]map[string]interface{}, error) {
+	tmplSrc := format
+	if !strings.Contains(tmplSrc, "{{") {
+		// Check for unsupported JSONPath syntax against a copy of format
+		// with every field reference it understands blanked out, so a
+		// valid nested match like "{.Namespaces.MNT}" isn't mistaken for
+		// leftover single-brace syntax once it's been wrapped in "{{ }}".
+		if bad := jsonPathLike.FindString(jsonPathField.ReplaceAllString(tmplSrc, "")); bad != "" {
+			return nil, errors.Errorf("unsupported JSONPath expression %q in format %q", bad, format)
+		}
+		tmplSrc = jsonPathField.ReplaceAllString(tmplSrc, "{{$1}}")
+	}
+
+	tmpl, err := template.New("ps").Funcs(psTemplateFuncs).Parse(tmplSrc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid format %q", format)
+	}
+
+	fields := PsFields(format)
+	rows := make([]map[string]interface{}, 0, len(psOutput))
+	for _, ctr := range psOutput {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, ctr); err != nil {
+			return nil, errors.Wrapf(err, "failed to project container %s", ctr.ID)
+		}
+
+		row := make(map[string]interface{}, len(fields)+1)
+		v := reflect.ValueOf(ctr)
+		for _, field := range fields {
+			f := v.FieldByName(field)
+			if f.IsValid() {
+				row[field] = f.Interface()
+			}
+		}
+		row["Output"] = buf.String()
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
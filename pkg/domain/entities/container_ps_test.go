@@ -0,0 +1,307 @@
+package entities
+
+import (
+	"testing"
+)
+
+func namedContainer(id string, names []string, state string, labels map[string]string, created int64) ListContainer {
+	return ListContainer{
+		ID:      id,
+		Names:   names,
+		State:   state,
+		Labels:  labels,
+		Created: created,
+	}
+}
+
+func TestFilterPsOutputSameKeyIsOred(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"running1"}, "running", nil, 1),
+		namedContainer("2", []string{"paused1"}, "paused", nil, 2),
+		namedContainer("3", []string{"exited1"}, "exited", nil, 3),
+	}
+
+	filtered, err := FilterPsOutput([]string{"status=running", "status=paused"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 2 {
+		t.Fatalf("expected 2 containers (running or paused), got %d", len(filtered))
+	}
+	for _, ctr := range filtered {
+		if ctr.State == "exited" {
+			t.Fatalf("exited container should not match status=running,status=paused")
+		}
+	}
+}
+
+func TestFilterPsOutputDifferentKeysAreAnded(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"web1"}, "running", map[string]string{"env": "prod"}, 1),
+		namedContainer("2", []string{"web2"}, "running", map[string]string{"env": "dev"}, 2),
+		namedContainer("3", []string{"web3"}, "exited", map[string]string{"env": "prod"}, 3),
+	}
+
+	filtered, err := FilterPsOutput([]string{"status=running", "label=env=prod"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "1" {
+		t.Fatalf("expected only container 1 to match status=running AND label=env=prod, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputLabelValueContainingBang(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"c1"}, "running", map[string]string{"rule": "a!=b"}, 1),
+		namedContainer("2", []string{"c2"}, "running", map[string]string{"rule": "other"}, 2),
+	}
+
+	filtered, err := FilterPsOutput([]string{"label=rule=a!=b"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "1" {
+		t.Fatalf("expected only container 1 to match label=rule=a!=b, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputNameRegex(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"web-1"}, "running", nil, 1),
+		namedContainer("2", []string{"db-1"}, "running", nil, 2),
+	}
+
+	filtered, err := FilterPsOutput([]string{"name=/^web-/"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "1" {
+		t.Fatalf("expected only container 1 to match name=/^web-/, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputSinceAndBefore(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"c1"}, "running", nil, 1),
+		namedContainer("2", []string{"c2"}, "running", nil, 2),
+		namedContainer("3", []string{"c3"}, "running", nil, 3),
+	}
+
+	since, err := FilterPsOutput([]string{"since=2"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(since) != 1 || since[0].ID != "3" {
+		t.Fatalf("expected only container 3 to be since=2, got %+v", since)
+	}
+
+	before, err := FilterPsOutput([]string{"before=2"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(before) != 1 || before[0].ID != "1" {
+		t.Fatalf("expected only container 1 to be before=2, got %+v", before)
+	}
+}
+
+func TestFilterPsOutputNegation(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("1", []string{"c1"}, "running", nil, 1),
+		namedContainer("2", []string{"c2"}, "paused", nil, 2),
+	}
+
+	filtered, err := FilterPsOutput([]string{"status!=running"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "2" {
+		t.Fatalf("expected only container 2 to match status!=running, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputHealthUnsupported(t *testing.T) {
+	psOutput := SortListContainers{namedContainer("1", []string{"c1"}, "running", nil, 1)}
+
+	if _, err := FilterPsOutput([]string{"health=healthy"}, psOutput); err == nil {
+		t.Fatalf("expected health= filter to be rejected, got none")
+	}
+}
+
+func TestFilterPsOutputID(t *testing.T) {
+	psOutput := SortListContainers{
+		namedContainer("abc123", []string{"c1"}, "running", nil, 1),
+		namedContainer("def456", []string{"c2"}, "running", nil, 2),
+	}
+
+	filtered, err := FilterPsOutput([]string{"id=abc"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "abc123" {
+		t.Fatalf("expected only container abc123 to match id=abc, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputPod(t *testing.T) {
+	psOutput := SortListContainers{
+		{ID: "1", Names: []string{"c1"}, Pod: "podA", PodName: "nameA"},
+		{ID: "2", Names: []string{"c2"}, Pod: "podB", PodName: "nameB"},
+	}
+
+	filtered, err := FilterPsOutput([]string{"pod=podA"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "1" {
+		t.Fatalf("expected only container 1 to match pod=podA, got %+v", filtered)
+	}
+
+	filtered, err = FilterPsOutput([]string{"pod=nameB"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "2" {
+		t.Fatalf("expected only container 2 to match pod=nameB, got %+v", filtered)
+	}
+}
+
+func TestFilterPsOutputExited(t *testing.T) {
+	psOutput := SortListContainers{
+		{ID: "1", Names: []string{"c1"}, Exited: true, ExitCode: 0},
+		{ID: "2", Names: []string{"c2"}, Exited: true, ExitCode: 1},
+		{ID: "3", Names: []string{"c3"}, Exited: false, ExitCode: 1},
+	}
+
+	filtered, err := FilterPsOutput([]string{"exited=1"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "2" {
+		t.Fatalf("expected only container 2 to match exited=1, got %+v", filtered)
+	}
+
+	if _, err := FilterPsOutput([]string{"exited=nope"}, psOutput); err == nil {
+		t.Fatalf("expected a non-integer exited filter to error")
+	}
+}
+
+func TestFilterPsOutputAncestor(t *testing.T) {
+	psOutput := SortListContainers{
+		{ID: "1", Names: []string{"c1"}, Image: "docker.io/library/alpine:3.12"},
+		{ID: "2", Names: []string{"c2"}, Image: "docker.io/library/busybox:latest"},
+	}
+
+	filtered, err := FilterPsOutput([]string{"ancestor=docker.io/library/alpine"}, psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "1" {
+		t.Fatalf("expected only container 1 to match ancestor=docker.io/library/alpine, got %+v", filtered)
+	}
+}
+
+func TestSortPsOutputCompoundKeys(t *testing.T) {
+	psOutput := SortListContainers{
+		{ID: "1", Names: []string{"c1"}, Pod: "podB", Created: 1},
+		{ID: "2", Names: []string{"c2"}, Pod: "podA", Created: 2},
+		{ID: "3", Names: []string{"c3"}, Pod: "podA", Created: 3},
+	}
+
+	sorted, err := SortPsOutput("pod,-created", psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := []string{sorted[0].ID, sorted[1].ID, sorted[2].ID}
+	want := []string{"3", "2", "1"}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("expected pod,-created order %v, got %v", want, ids)
+		}
+	}
+}
+
+func TestSortPsOutputReverse(t *testing.T) {
+	psOutput := SortListContainers{
+		{ID: "1", Names: []string{"c1"}, Created: 1},
+		{ID: "2", Names: []string{"c2"}, Created: 3},
+		{ID: "3", Names: []string{"c3"}, Created: 2},
+	}
+
+	sorted, err := SortPsOutput("-created", psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := []string{sorted[0].ID, sorted[1].ID, sorted[2].ID}
+	want := []string{"2", "3", "1"}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("expected -created order %v, got %v", want, ids)
+		}
+	}
+}
+
+func TestSortPsOutputInvalidKey(t *testing.T) {
+	psOutput := SortListContainers{{ID: "1", Names: []string{"c1"}}}
+
+	if _, err := SortPsOutput("bogus", psOutput); err == nil {
+		t.Fatalf("expected an invalid sort key to error")
+	}
+	if _, err := SortPsOutput("pod,bogus", psOutput); err == nil {
+		t.Fatalf("expected an invalid subkey to error even when a valid key precedes it")
+	}
+}
+
+func TestProjectPsOutputNestedJSONPath(t *testing.T) {
+	psOutput := SortListContainers{{
+		ID:         "1",
+		Names:      []string{"c1"},
+		Namespaces: ListContainerNamespaces{MNT: "/proc/1/ns/mnt"},
+	}}
+
+	rows, err := ProjectPsOutput("{.Namespaces.MNT}", psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["Output"] != "/proc/1/ns/mnt" {
+		t.Fatalf("expected nested JSONPath to resolve to the MNT namespace, got %+v", rows)
+	}
+}
+
+func TestProjectPsOutputUnsupportedJSONPathFailsFast(t *testing.T) {
+	psOutput := SortListContainers{{ID: "1", Names: []string{"c1"}}}
+
+	if _, err := ProjectPsOutput("{.Names[0]}", psOutput); err == nil {
+		t.Fatalf("expected unsupported JSONPath syntax to error, got none")
+	}
+}
+
+func TestProjectPsOutputGoTemplate(t *testing.T) {
+	psOutput := SortListContainers{{ID: "1", Names: []string{"c1"}}}
+
+	rows, err := ProjectPsOutput("{{.ID}}", psOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["Output"] != "1" || rows[0]["ID"] != "1" {
+		t.Fatalf("expected ID to be projected, got %+v", rows)
+	}
+}
+
+func TestPsFieldsAndNeedsHints(t *testing.T) {
+	fields := PsFields("{{.Names}} {{humanDuration .StartedAt}}")
+	if !containsField(fields, "Names") || !containsField(fields, "StartedAt") {
+		t.Fatalf("expected Names and StartedAt in %v", fields)
+	}
+	if NeedsSize(fields) {
+		t.Fatalf("format does not reference Size, NeedsSize should be false")
+	}
+	if !NeedsSize(PsFields("{{.Size}}")) {
+		t.Fatalf("format references Size, NeedsSize should be true")
+	}
+	if !NeedsNamespaces(PsFields("{.Namespaces.MNT}")) {
+		t.Fatalf("format references Namespaces, NeedsNamespaces should be true")
+	}
+}